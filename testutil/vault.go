@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/hashicorp/nomad/helper/freeport"
-	"github.com/hashicorp/nomad/helper/testlog"
 	"github.com/hashicorp/nomad/helper/uuid"
 	"github.com/hashicorp/nomad/nomad/structs/config"
 	vapi "github.com/hashicorp/vault/api"
@@ -17,6 +16,26 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// VaultOption configures a TestVault at construction time. See
+// WithPerformanceStandby and WithLicense.
+type VaultOption func(*vaultOpts)
+
+// vaultOpts accumulates the effect of VaultOptions passed to a New*
+// constructor. Settings that need to reach the subprocess (e.g. Enterprise
+// feature toggles normally read from the environment) are applied to that
+// instance's cmd.Env rather than the process-wide environment, so options
+// passed for one TestVault can't leak into another concurrently-running
+// test's instance.
+type vaultOpts struct {
+	env []string
+}
+
+func (o *vaultOpts) apply(opts []VaultOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
 // TestVault is a test helper. It uses a fork/exec model to create a test Vault
 // server instance in the background and can be initialized with policies, roles
 // and backends mounted. The test Vault instances can be used to run a unit test
@@ -30,18 +49,52 @@ type TestVault struct {
 	t      testing.T
 	waitCh chan error
 
+	// root is nil for a TestVault returned by one of the New* constructors.
+	// A namespace-scoped handle returned by Namespace sets this to the
+	// TestVault that actually owns the subprocess, so Stop can refuse to act
+	// on it instead of killing the process out from under every other
+	// handle sharing it.
+	root *TestVault
+
 	// ports (if any) that are reserved through freeport that must be returned
 	// at the end of a test, done when Stop() is called.
 	ports []int
 
+	// tlsDir (if any) holds generated CA/server/client key material for a
+	// TLS-enabled instance and is removed when Stop() is called.
+	tlsDir string
+
+	// initFn, if set, is invoked by waitForAPI once the subprocess's HTTP(S)
+	// API is reachable but before waitForAPI confirms the server is
+	// initialized. Dev-mode instances start pre-initialized with a
+	// caller-chosen root token and leave this nil; a non-dev instance (e.g.
+	// the TLS-enabled server started by newTestVaultTLSDelayed) sets it to
+	// perform Init/Unseal and report back the root token Vault generated.
+	initFn func(*vapi.Client) (string, error)
+
 	Addr      string
 	HTTPAddr  string
 	RootToken string
 	Config    *config.VaultConfig
 	Client    *vapi.Client
+
+	// TLS material populated by NewTestVaultTLS/NewTestVaultTLSDelayed; zero
+	// valued for plaintext dev-mode instances.
+	CACert         string
+	CAFile         string
+	ClientCert     string
+	ClientCertFile string
+	ClientKey      string
+	ClientKeyFile  string
+
+	// Logs taps the subprocess's JSON log output; see VaultLogTap.
+	Logs *VaultLogTap
 }
 
-func NewTestVaultFromPath(t testing.T, binary string) *TestVault {
+func NewTestVaultFromPath(t testing.T, binary string, opts ...VaultOption) *TestVault {
+	var vo vaultOpts
+	vo.apply(opts)
+
 	var ports []int
 	nextPort := func() int {
 		next := freeport.MustTake(1)
@@ -58,9 +111,13 @@ func NewTestVaultFromPath(t testing.T, binary string) *TestVault {
 		http := fmt.Sprintf("http://127.0.0.1:%d", port)
 		root := fmt.Sprintf("-dev-root-token-id=%s", token)
 
-		cmd := exec.Command(binary, "server", "-dev", bind, root)
-		cmd.Stdout = testlog.NewWriter(t)
-		cmd.Stderr = testlog.NewWriter(t)
+		cmd := exec.Command(binary, "server", "-dev", bind, root, "-log-format=json")
+		if len(vo.env) > 0 {
+			cmd.Env = append(os.Environ(), vo.env...)
+		}
+		logTap, logWriter := newVaultLogTap(t)
+		cmd.Stdout = logWriter
+		cmd.Stderr = logWriter
 
 		// Build the config
 		conf := vapi.DefaultConfig()
@@ -87,6 +144,7 @@ func NewTestVaultFromPath(t testing.T, binary string) *TestVault {
 				Token:   token,
 				Addr:    http,
 			},
+			Logs: logTap,
 		}
 
 		if err := tv.cmd.Start(); err != nil {
@@ -132,24 +190,31 @@ func NewTestVaultFromPath(t testing.T, binary string) *TestVault {
 }
 
 // NewTestVault returns a new TestVault instance that is ready for API calls
-func NewTestVault(t testing.T) *TestVault {
+func NewTestVault(t testing.T, opts ...VaultOption) *TestVault {
 	// Lookup vault from the path
-	return NewTestVaultFromPath(t, "vault")
+	return NewTestVaultFromPath(t, "vault", opts...)
 }
 
 // NewTestVaultDelayed returns a test Vault server that has not been started.
 // Start must be called and it is the callers responsibility to deal with any
 // port conflicts that may occur and retry accordingly.
-func NewTestVaultDelayed(t testing.T) *TestVault {
+func NewTestVaultDelayed(t testing.T, opts ...VaultOption) *TestVault {
+	var vo vaultOpts
+	vo.apply(opts)
+
 	port := freeport.MustTake(1)[0]
 	token := uuid.Generate()
 	bind := fmt.Sprintf("-dev-listen-address=127.0.0.1:%d", port)
 	http := fmt.Sprintf("http://127.0.0.1:%d", port)
 	root := fmt.Sprintf("-dev-root-token-id=%s", token)
 
-	cmd := exec.Command("vault", "server", "-dev", bind, root)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := exec.Command("vault", "server", "-dev", bind, root, "-log-format=json")
+	if len(vo.env) > 0 {
+		cmd.Env = append(os.Environ(), vo.env...)
+	}
+	logTap, logWriter := newVaultLogTap(t)
+	cmd.Stdout = logWriter
+	cmd.Stderr = logWriter
 
 	// Build the config
 	conf := vapi.DefaultConfig()
@@ -175,6 +240,7 @@ func NewTestVaultDelayed(t testing.T) *TestVault {
 			Token:   token,
 			Addr:    http,
 		},
+		Logs: logTap,
 	}
 
 	return tv
@@ -209,7 +275,16 @@ func (tv *TestVault) Start() error {
 
 // Stop stops the test Vault server
 func (tv *TestVault) Stop() {
+	if tv.root != nil {
+		tv.t.Fatalf("testutil: Stop called on a namespace-scoped TestVault handle returned by Namespace; only the root TestVault that started the subprocess may be stopped")
+		return
+	}
+
 	defer freeport.Return(tv.ports)
+	defer tv.Logs.Close()
+	if tv.tlsDir != "" {
+		defer os.RemoveAll(tv.tlsDir)
+	}
 
 	if tv.cmd.Process == nil {
 		return
@@ -231,9 +306,25 @@ func (tv *TestVault) Stop() {
 	}
 }
 
-// waitForAPI waits for the Vault HTTP endpoint to start
-// responding. This is an indication that the agent has started.
+// waitForAPI waits for the Vault HTTP endpoint to start responding, runs
+// initFn (if set) to bring a non-dev server up from uninitialized/sealed to
+// ready, then confirms the server reports itself initialized. This is an
+// indication that the agent has started.
 func (tv *TestVault) waitForAPI() error {
+	if err := tv.waitForReachable(); err != nil {
+		return err
+	}
+
+	if tv.initFn != nil {
+		token, err := tv.initFn(tv.Client)
+		if err != nil {
+			return err
+		}
+		tv.RootToken = token
+		tv.Config.Token = token
+		tv.Client.SetToken(token)
+	}
+
 	var waitErr error
 	WaitForResult(func() (bool, error) {
 		inited, err := tv.Client.Sys().InitStatus()
@@ -247,6 +338,20 @@ func (tv *TestVault) waitForAPI() error {
 	return waitErr
 }
 
+// waitForReachable waits until the Vault HTTP(S) API responds at all,
+// regardless of init/seal status, indicating the subprocess is up and
+// listening.
+func (tv *TestVault) waitForReachable() error {
+	var waitErr error
+	WaitForResult(func() (bool, error) {
+		_, err := tv.Client.Sys().InitStatus()
+		return err == nil, nil
+	}, func(err error) {
+		waitErr = err
+	})
+	return waitErr
+}
+
 // VaultVersion returns the Vault version as a string or an error if it couldn't
 // be determined
 func VaultVersion() (string, error) {
@@ -0,0 +1,175 @@
+package testutil
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/helper/freeport"
+	vapi "github.com/hashicorp/vault/api"
+	testing "github.com/mitchellh/go-testing-interface"
+)
+
+// LeaseHarness sits in front of a TestVault's HTTP API behind an in-process
+// proxy, letting tests deterministically drive token/lease renewal and
+// revocation and inject faults (errors, stalls) into the request path that
+// Nomad's Vault client exercises. Tests should dial the harness's Client
+// rather than the wrapped TestVault's, since only requests that go through
+// the proxy are subject to fault injection.
+type LeaseHarness struct {
+	tv *TestVault
+	t  testing.T
+
+	proxy    *httputil.ReverseProxy
+	listener net.Listener
+	server   *http.Server
+	port     int
+
+	// Addr is the proxy's HTTP address; Client is a Vault API client
+	// pointed at Addr with tv's root token set.
+	Addr   string
+	Client *vapi.Client
+
+	mu        sync.Mutex
+	stallFor  time.Duration
+	failN     int
+	failCode  int
+	dropNextN int
+}
+
+// NewLeaseHarness wraps tv with a fault-injecting proxy and returns the
+// harness. The harness's own Client should be used in place of tv.Client for
+// any request that should be subject to fault injection.
+func NewLeaseHarness(t testing.T, tv *TestVault) *LeaseHarness {
+	target, err := url.Parse(tv.HTTPAddr)
+	if err != nil {
+		t.Fatalf("failed to parse Vault address %q: %v", tv.HTTPAddr, err)
+	}
+
+	lh := &LeaseHarness{tv: tv, t: t}
+
+	lh.proxy = &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.Host = target.Host
+		},
+	}
+
+	port := freeport.MustTake(1)[0]
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		freeport.Return([]int{port})
+		t.Fatalf("failed to listen for lease harness proxy: %v", err)
+	}
+
+	server := &http.Server{Handler: lh}
+	go server.Serve(listener)
+
+	lh.listener = listener
+	lh.server = server
+	lh.port = port
+	lh.Addr = "http://" + addr
+
+	conf := vapi.DefaultConfig()
+	conf.Address = lh.Addr
+
+	client, err := vapi.NewClient(conf)
+	if err != nil {
+		t.Fatalf("failed to build Vault API client for lease harness: %v", err)
+	}
+	client.SetToken(tv.RootToken)
+	lh.Client = client
+
+	return lh
+}
+
+// ServeHTTP implements http.Handler, applying any pending fault injection
+// before forwarding the request to the wrapped TestVault.
+func (lh *LeaseHarness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lh.mu.Lock()
+	stall := lh.stallFor
+	drop := lh.dropNextN > 0
+	if drop {
+		lh.dropNextN--
+	}
+	// A dropped request doesn't use up one of the FailNextN failures.
+	shouldFail := !drop && lh.failN > 0
+	code := lh.failCode
+	if shouldFail {
+		lh.failN--
+	}
+	lh.mu.Unlock()
+
+	if stall > 0 {
+		time.Sleep(stall)
+	}
+
+	if drop {
+		hj, ok := w.(http.Hijacker)
+		if ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		return
+	}
+
+	if shouldFail {
+		http.Error(w, "injected fault", code)
+		return
+	}
+
+	lh.proxy.ServeHTTP(w, r)
+}
+
+// StallRenewals delays every request through the harness by d until the
+// next call to StallRenewals(0), reproducing a Vault that is slow to
+// respond to renew-self calls.
+func (lh *LeaseHarness) StallRenewals(d time.Duration) {
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+	lh.stallFor = d
+}
+
+// FailNextN causes the next n requests through the harness to fail
+// immediately with the given HTTP status code instead of reaching Vault.
+func (lh *LeaseHarness) FailNextN(n int, status int) {
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+	lh.failN = n
+	lh.failCode = status
+}
+
+// DropNextN causes the next n requests through the harness to have their
+// underlying connection closed without a response, simulating a network
+// drop rather than an HTTP-level error.
+func (lh *LeaseHarness) DropNextN(n int) {
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+	lh.dropNextN = n
+}
+
+// ExpireToken immediately revokes the token with the given accessor,
+// forcing any renewer watching it to observe an expiration on its next
+// renew attempt.
+func (lh *LeaseHarness) ExpireToken(accessor string) error {
+	return lh.tv.Client.Auth().Token().RevokeAccessor(accessor)
+}
+
+// Close stops the proxy listener and returns its port to the freeport pool.
+// It does not stop the wrapped TestVault; callers remain responsible for
+// calling tv.Stop().
+func (lh *LeaseHarness) Close() {
+	if lh.server != nil {
+		lh.server.Close()
+	}
+	freeport.Return([]int{lh.port})
+}
@@ -0,0 +1,167 @@
+package testutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	testing "github.com/mitchellh/go-testing-interface"
+)
+
+// VaultLogEntry is a single parsed line of Vault's JSON log output.
+type VaultLogEntry struct {
+	Time    string
+	Level   string
+	Message string
+	Raw     map[string]interface{}
+}
+
+// VaultLogTap parses Vault's `-log-format=json` output from the subprocess
+// as it's written, buffers it in a fixed-size ring, and lets tests block
+// on or assert against specific log lines instead of polling API endpoints
+// like Sys().InitStatus() to learn that an event has occurred.
+//
+// A VaultLogTap is safe for concurrent use: WaitForLog and AssertLogged may
+// be called from the test goroutine while the subprocess pump writes to it
+// from another.
+type VaultLogTap struct {
+	mu      sync.Mutex
+	entries []VaultLogEntry
+	max     int
+
+	pw *io.PipeWriter
+}
+
+// defaultLogTapSize bounds how many log lines VaultLogTap retains.
+const defaultLogTapSize = 1024
+
+// newVaultLogTap creates a tap and starts a goroutine pumping parsed JSON
+// log lines from the subprocess's combined stdout/stderr pipe into it. The
+// returned io.Writer should be set as cmd.Stdout (and cmd.Stderr, since
+// Vault interleaves both onto the same writer in dev mode).
+func newVaultLogTap(t testing.T) (*VaultLogTap, io.Writer) {
+	pr, pw := io.Pipe()
+
+	tap := &VaultLogTap{
+		max: defaultLogTapSize,
+		pw:  pw,
+	}
+
+	go tap.pump(t, pr)
+
+	return tap, pw
+}
+
+func (v *VaultLogTap) pump(t testing.T, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	// Vault log lines can exceed bufio.Scanner's 64KB default (e.g. audit
+	// entries embedding full request/response bodies).
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		var raw map[string]interface{}
+		entry := VaultLogEntry{}
+		if err := json.Unmarshal(line, &raw); err == nil {
+			entry.Raw = raw
+			if s, ok := raw["@timestamp"].(string); ok {
+				entry.Time = s
+			}
+			if s, ok := raw["@level"].(string); ok {
+				entry.Level = s
+			}
+			if s, ok := raw["@message"].(string); ok {
+				entry.Message = s
+			}
+		} else {
+			// Not JSON (e.g. startup banner before -log-format=json takes
+			// effect); keep the raw line as the message so Dump still shows
+			// it.
+			entry.Message = string(line)
+		}
+
+		v.append(entry)
+	}
+}
+
+// Close closes the pipe feeding the log pump, which causes pump's scanner to
+// observe EOF and return. Callers must call Close once the subprocess has
+// exited (or been killed) to avoid leaking the pump goroutine; os/exec does
+// not close a caller-supplied cmd.Stdout/cmd.Stderr on its own.
+func (v *VaultLogTap) Close() error {
+	return v.pw.Close()
+}
+
+// Clear discards all captured entries. Used when a TestVault is recycled
+// from a pool so a reused instance doesn't hand a fresh test stale log
+// lines from whatever test ran before it.
+func (v *VaultLogTap) Clear() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.entries = nil
+}
+
+func (v *VaultLogTap) append(entry VaultLogEntry) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.entries = append(v.entries, entry)
+	if len(v.entries) > v.max {
+		v.entries = v.entries[len(v.entries)-v.max:]
+	}
+}
+
+// logPollInterval is how often WaitForLog rechecks the buffer for a
+// matching entry.
+const logPollInterval = 20 * time.Millisecond
+
+// WaitForLog blocks until an entry satisfying predicate has been observed,
+// or timeout elapses, in which case it returns false.
+func (v *VaultLogTap) WaitForLog(predicate func(VaultLogEntry) bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if v.matches(predicate) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(logPollInterval)
+	}
+}
+
+func (v *VaultLogTap) matches(predicate func(VaultLogEntry) bool) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, e := range v.entries {
+		if predicate(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertLogged reports whether any captured entry's message contains
+// pattern.
+func (v *VaultLogTap) AssertLogged(pattern string) bool {
+	return v.matches(func(e VaultLogEntry) bool {
+		return strings.Contains(e.Message, pattern)
+	})
+}
+
+// Dump returns a snapshot of every entry captured so far, in order.
+func (v *VaultLogTap) Dump() []VaultLogEntry {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	out := make([]VaultLogEntry, len(v.entries))
+	copy(out, v.entries)
+	return out
+}
@@ -0,0 +1,256 @@
+package testutil
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	testing "github.com/mitchellh/go-testing-interface"
+)
+
+const (
+	// defaultVaultPoolSize is used when NOMAD_TEST_VAULT_POOL_SIZE is unset.
+	defaultVaultPoolSize = 4
+
+	vaultPoolSizeEnvVar = "NOMAD_TEST_VAULT_POOL_SIZE"
+)
+
+// TestVaultPool keeps a small set of already-started dev Vault processes
+// warm and hands them out to tests via Acquire/Release, avoiding the
+// fork/exec and unseal wait on every test that needs a Vault. Set
+// NOMAD_TEST_VAULT_POOL_SIZE=0 to disable pooling and fall back to a fresh
+// TestVault per Acquire.
+type TestVaultPool struct {
+	size int
+
+	mu   sync.Mutex
+	idle []*TestVault
+}
+
+// sharedVaultPool is the package-level pool used by AcquireTestVault.
+var sharedVaultPool = newTestVaultPool()
+
+func newTestVaultPool() *TestVaultPool {
+	size := defaultVaultPoolSize
+	if v := os.Getenv(vaultPoolSizeEnvVar); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			size = n
+		}
+	}
+	return &TestVaultPool{size: size}
+}
+
+// AcquireTestVault checks out a TestVault from the shared pool, starting a
+// new one if the pool is empty or disabled. The instance is returned to the
+// pool by a t.Cleanup hook that Acquire registers, so callers don't call
+// Release themselves.
+func AcquireTestVault(t testing.T) *TestVault {
+	return sharedVaultPool.Acquire(t)
+}
+
+// Acquire checks out a TestVault. Pooled instances are reset to a clean slate
+// by Release before they go back into the pool, so a reused instance starts
+// clean. A t.Cleanup hook is registered so the instance is returned to the pool (or
+// stopped, if pooling is disabled) even if the test panics.
+func (p *TestVaultPool) Acquire(t testing.T) *TestVault {
+	tv := p.take(t)
+
+	ct, ok := t.(cleanupT)
+	if !ok {
+		t.Fatalf("testutil: AcquireTestVault requires a testing.T implementing Cleanup(func()); got %T", t)
+		return tv
+	}
+	ct.Cleanup(func() {
+		p.Release(tv)
+	})
+
+	return tv
+}
+
+func (p *TestVaultPool) take(t testing.T) *TestVault {
+	if p.size > 0 {
+		p.mu.Lock()
+		if n := len(p.idle); n > 0 {
+			tv := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.mu.Unlock()
+			tv.t = t
+			return tv
+		}
+		p.mu.Unlock()
+	}
+
+	return NewTestVault(t)
+}
+
+// Release resets tv to a clean slate and returns it to the pool. If the
+// pool is disabled, already at capacity, or the reset fails, tv is stopped
+// instead.
+func (p *TestVaultPool) Release(tv *TestVault) {
+	if p.size <= 0 {
+		tv.Stop()
+		return
+	}
+
+	if err := tv.reset(); err != nil {
+		tv.Stop()
+		return
+	}
+
+	p.mu.Lock()
+	full := len(p.idle) >= p.size
+	if !full {
+		p.idle = append(p.idle, tv)
+	}
+	p.mu.Unlock()
+
+	if full {
+		tv.Stop()
+	}
+}
+
+// cleanupT is satisfied by *testing.T; it's split out so TestVaultPool can
+// register cleanup without requiring the fuller stdlib testing.T interface
+// that go-testing-interface.T doesn't itself expose.
+type cleanupT interface {
+	Cleanup(func())
+}
+
+// reset unmounts non-default secret engines, revokes child tokens, deletes
+// created policies, and removes any Enterprise namespaces created against
+// tv, returning it to roughly the state a freshly started dev-mode Vault
+// would be in.
+func (tv *TestVault) reset() error {
+	mounts, err := tv.Client.Sys().ListMounts()
+	if err != nil {
+		return err
+	}
+	for path, mount := range mounts {
+		if isDefaultMount(path, mount.Type) {
+			continue
+		}
+		if err := tv.Client.Sys().Unmount(path); err != nil {
+			return err
+		}
+	}
+
+	auths, err := tv.Client.Sys().ListAuth()
+	if err != nil {
+		return err
+	}
+	for path, auth := range auths {
+		if isDefaultAuth(path, auth.Type) {
+			continue
+		}
+		if err := tv.Client.Sys().DisableAuth(path); err != nil {
+			return err
+		}
+	}
+
+	policies, err := tv.Client.Sys().ListPolicies()
+	if err != nil {
+		return err
+	}
+	for _, name := range policies {
+		if isDefaultPolicy(name) {
+			continue
+		}
+		if err := tv.Client.Sys().DeletePolicy(name); err != nil {
+			return err
+		}
+	}
+
+	if err := tv.revokeChildTokens(); err != nil {
+		return err
+	}
+
+	if err := tv.deleteNamespaces(); err != nil {
+		return err
+	}
+
+	tv.Logs.Clear()
+	return nil
+}
+
+// deleteNamespaces removes every Enterprise namespace created against tv
+// (e.g. via Namespace), so a pooled instance doesn't keep handing out
+// namespaces, and everything mounted or issued inside them, to every test
+// that acquires it after the one that created them. It's a no-op against an
+// OSS Vault binary, which doesn't support namespaces at all.
+func (tv *TestVault) deleteNamespaces() error {
+	if !IsVaultEnterprise() {
+		return nil
+	}
+
+	resp, err := tv.Client.Sys().ListNamespaces()
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+
+	for _, ns := range resp.Keys {
+		if err := tv.Client.Sys().DeleteNamespace(strings.TrimSuffix(ns, "/")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeChildTokens revokes every issued token except the dev-mode root
+// token, which must survive a reset so the pool can keep using it.
+func (tv *TestVault) revokeChildTokens() error {
+	// Lookups by accessor don't return the token ID, so the root token is
+	// recognized by its own accessor.
+	self, err := tv.Client.Auth().Token().LookupSelf()
+	if err != nil {
+		return err
+	}
+	rootAccessor, _ := self.Data["accessor"].(string)
+
+	secret, err := tv.Client.Logical().List("auth/token/accessors")
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil
+	}
+
+	accessors, _ := secret.Data["keys"].([]interface{})
+	for _, a := range accessors {
+		accessor, ok := a.(string)
+		if !ok || accessor == rootAccessor {
+			continue
+		}
+
+		// Skip accessors whose token is already gone, e.g. revoked along
+		// with a parent earlier in this loop.
+		if _, err := tv.Client.Auth().Token().LookupAccessor(accessor); err != nil {
+			continue
+		}
+
+		if err := tv.Client.Auth().Token().RevokeAccessor(accessor); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isDefaultMount(path, typ string) bool {
+	switch path {
+	case "secret/", "identity/", "cubbyhole/", "sys/":
+		return true
+	}
+	return typ == "system" || typ == "identity" || typ == "cubbyhole"
+}
+
+func isDefaultAuth(path, typ string) bool {
+	return path == "token/" || typ == "token"
+}
+
+func isDefaultPolicy(name string) bool {
+	return name == "root" || name == "default"
+}
@@ -0,0 +1,139 @@
+package testutil
+
+import (
+	"fmt"
+	"strings"
+
+	vapi "github.com/hashicorp/vault/api"
+)
+
+// KVSpec describes a single write into a KV secrets engine, either version 1
+// or version 2. The Version field determines whether Data is written as-is
+// (v1) or wrapped under a "data" key (v2). Path is used unchanged in both
+// cases; no "data/" segment is added, so a v2 Path must already include it
+// (e.g. "secret/data/foo").
+type KVSpec struct {
+	Path    string
+	Version int
+	Data    map[string]interface{}
+}
+
+// MountSpec describes a secret engine to mount during Seed.
+type MountSpec struct {
+	Path    string
+	Options *vapi.MountInput
+}
+
+// AuthSpec describes an auth method to enable during Seed.
+type AuthSpec struct {
+	Path    string
+	Options *vapi.EnableAuthOptions
+}
+
+// VaultLayout describes the full set of mounts, policies, auth methods, KV
+// data and tokens that Seed should apply to a TestVault. Each field is
+// optional; only the non-empty ones are applied.
+type VaultLayout struct {
+	Mounts   []MountSpec
+	Policies map[string]string
+	Auths    []AuthSpec
+	KVs      []KVSpec
+	Tokens   map[string]*vapi.TokenCreateRequest
+}
+
+// Mount enables a secret engine at path, e.g. Mount("pki", &vapi.MountInput{Type: "pki"}).
+func (tv *TestVault) Mount(path string, opts *vapi.MountInput) error {
+	return tv.Client.Sys().Mount(path, opts)
+}
+
+// WritePolicy creates or updates a named ACL policy from its HCL rules.
+func (tv *TestVault) WritePolicy(name, hcl string) error {
+	return tv.Client.Sys().PutPolicy(name, hcl)
+}
+
+// EnableAuth enables an auth method at path, e.g.
+// EnableAuth("approle", &vapi.EnableAuthOptions{Type: "approle"}).
+func (tv *TestVault) EnableAuth(path string, opts *vapi.EnableAuthOptions) error {
+	return tv.Client.Sys().EnableAuthWithOptions(path, opts)
+}
+
+// WriteKV writes data to a KV secrets engine mounted at path, accounting for
+// the difference in request shape between KV v1 and v2.
+func (tv *TestVault) WriteKV(path string, version int, data map[string]interface{}) error {
+	if version == 2 {
+		data = map[string]interface{}{"data": data}
+	}
+	_, err := tv.Client.Logical().Write(path, data)
+	return err
+}
+
+// CreateToken creates a token from the given request and returns the
+// resulting secret, which carries the new token in Auth.ClientToken.
+func (tv *TestVault) CreateToken(spec *vapi.TokenCreateRequest) (*vapi.Secret, error) {
+	return tv.Client.Auth().Token().Create(spec)
+}
+
+// Seed applies a VaultLayout to tv, mounting engines, writing policies,
+// enabling auth methods, seeding KV data and minting tokens. It is safe to
+// call more than once with the same spec: mounts and auth methods that
+// already exist at their path are left alone rather than erroring. The
+// returned map holds the *vapi.Secret minted for each of spec.Tokens, keyed
+// by the same name, so callers can pull out the created token string (via
+// Auth.ClientToken) for use in the test.
+func (tv *TestVault) Seed(spec *VaultLayout) (map[string]*vapi.Secret, error) {
+	if spec == nil {
+		return nil, nil
+	}
+
+	for _, m := range spec.Mounts {
+		if err := tv.Mount(m.Path, m.Options); err != nil && !isMountExistsErr(err) {
+			return nil, fmt.Errorf("failed to mount %q: %w", m.Path, err)
+		}
+	}
+
+	for name, hcl := range spec.Policies {
+		if err := tv.WritePolicy(name, hcl); err != nil {
+			return nil, fmt.Errorf("failed to write policy %q: %w", name, err)
+		}
+	}
+
+	for _, a := range spec.Auths {
+		if err := tv.EnableAuth(a.Path, a.Options); err != nil && !isMountExistsErr(err) {
+			return nil, fmt.Errorf("failed to enable auth %q: %w", a.Path, err)
+		}
+	}
+
+	for _, kv := range spec.KVs {
+		if err := tv.WriteKV(kv.Path, kv.Version, kv.Data); err != nil {
+			return nil, fmt.Errorf("failed to write kv %q: %w", kv.Path, err)
+		}
+	}
+
+	var tokens map[string]*vapi.Secret
+	for name, req := range spec.Tokens {
+		if req.DisplayName == "" {
+			req.DisplayName = name
+		}
+		secret, err := tv.CreateToken(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create token %q: %w", name, err)
+		}
+		if tokens == nil {
+			tokens = make(map[string]*vapi.Secret, len(spec.Tokens))
+		}
+		tokens[name] = secret
+	}
+
+	return tokens, nil
+}
+
+// isMountExistsErr returns true if err looks like Vault's "path is already
+// in use" response, which Seed treats as a no-op so it can be applied
+// idempotently against an already-provisioned TestVault.
+func isMountExistsErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "existing mount at") || strings.Contains(msg, "path is already in use")
+}